@@ -0,0 +1,90 @@
+// Package alloc implements a no-op backend: it only allocates (and renews)
+// a subnet lease and writes it out. It's useful when something other than
+// flannel sets up the actual data plane (e.g. a CNI plugin) but still wants
+// flannel's etcd-backed IPAM.
+package alloc
+
+import (
+	"net"
+	"sync"
+
+	"github.com/coreos/flannel/backend"
+	"github.com/coreos/flannel/pkg/ip"
+	"github.com/coreos/flannel/pkg/log"
+	"github.com/coreos/flannel/subnet"
+)
+
+type AllocBackend struct {
+	sm      *subnet.SubnetManager
+	lease   *subnet.Lease
+	leaseV6 *subnet.Lease
+
+	stop chan bool
+	wg   sync.WaitGroup
+}
+
+func New(sm *subnet.SubnetManager) backend.Backend {
+	return &AllocBackend{
+		sm:   sm,
+		stop: make(chan bool),
+	}
+}
+
+func (m *AllocBackend) Init(extIface *net.Interface, extIaddr net.IP, extV6addr net.IP, ipMasq bool) (*backend.SubnetDef, error) {
+	attrs := &subnet.LeaseAttrs{
+		PublicIP:    ip.FromIP(extIaddr),
+		BackendType: "alloc",
+	}
+	if extV6addr != nil {
+		attrs.PublicIPv6 = ip.FromIP6(extV6addr)
+	}
+
+	v4Lease, v6Lease, err := m.sm.AcquireLease(extIface, extIaddr, extV6addr, attrs, m.stop)
+	if err != nil {
+		return nil, err
+	}
+	m.lease = v4Lease
+	m.leaseV6 = v6Lease
+
+	sd := &backend.SubnetDef{
+		Net: v4Lease.Subnet,
+		MTU: extIface.MTU,
+	}
+	if v6Lease != nil {
+		sd.IPv6Net = v6Lease.IPv6Subnet
+	}
+
+	return sd, nil
+}
+
+func (m *AllocBackend) Run() {
+	m.wg.Add(1)
+	defer m.wg.Done()
+
+	receiver := make(chan subnet.Event)
+	m.sm.WatchLeases(receiver, m.stop)
+
+	for {
+		select {
+		case evt := <-receiver:
+			switch evt.Type {
+			case subnet.EventAdded:
+				log.Infof("Subnet added: %s", evt.Lease.Subnet)
+			case subnet.EventRemoved:
+				log.Infof("Subnet removed: %s", evt.Lease.Subnet)
+			}
+
+		case <-m.stop:
+			return
+		}
+	}
+}
+
+func (m *AllocBackend) Stop() {
+	close(m.stop)
+	m.wg.Wait()
+}
+
+func (m *AllocBackend) Name() string {
+	return "alloc"
+}
@@ -0,0 +1,27 @@
+// Package backend defines the interface flannel backends implement and the
+// types used to hand a lease back to main/trafficmanager once established.
+package backend
+
+import (
+	"net"
+
+	"github.com/coreos/flannel/pkg/ip"
+)
+
+// SubnetDef describes the lease(s) a backend obtained for this host.
+type SubnetDef struct {
+	Net     ip.IP4Net
+	MTU     int
+	IPv6Net ip.IP6Net
+}
+
+// Backend is implemented by every flannel transport (udp, alloc, ipsec, ...).
+// Init is called once at startup with the external iface/addresses this host
+// should use; Run blocks until Stop is called or an unrecoverable error
+// occurs.
+type Backend interface {
+	Init(extIface *net.Interface, extIaddr net.IP, extV6addr net.IP, ipMasq bool) (*SubnetDef, error)
+	Run()
+	Stop()
+	Name() string
+}
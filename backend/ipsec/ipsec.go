@@ -0,0 +1,279 @@
+// Package ipsec implements a flannel backend that encrypts inter-host
+// traffic with transport-mode ESP instead of UDP-encapsulating it. It
+// drives a local strongSwan charon daemon over the vici control protocol:
+// flannel itself never touches packets, it just tells charon which SAs to
+// bring up as peers come and go.
+package ipsec
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/coreos/flannel/backend"
+	"github.com/coreos/flannel/pkg/ip"
+	"github.com/coreos/flannel/pkg/log"
+	"github.com/coreos/flannel/pkg/metrics"
+	"github.com/coreos/flannel/subnet"
+)
+
+const (
+	defaultESPOverhead = 60
+	defaultESPProposal = "aes128-sha256-modp2048"
+	defaultIKEProposal = "aes128-sha256-modp2048"
+)
+
+type config struct {
+	PSK         string
+	UDPEncap    bool
+	ESPProposal string
+	IKEProposal string
+	ESPOverhead int
+}
+
+// IpsecBackend establishes a transport-mode ESP child SA to every peer
+// lease seen via sm.WatchLeases, keyed off a PSK shared out-of-band through
+// the etcd network config.
+type IpsecBackend struct {
+	sm  *subnet.SubnetManager
+	cfg config
+
+	lease *subnet.Lease
+	ourIP ip.IP4
+	vici  *viciClient
+
+	mu    sync.Mutex
+	conns map[string]bool // conn name -> loaded
+
+	stop chan bool
+	wg   sync.WaitGroup
+}
+
+func New(sm *subnet.SubnetManager, configBlob json.RawMessage) backend.Backend {
+	ib := &IpsecBackend{
+		sm: sm,
+		cfg: config{
+			ESPProposal: defaultESPProposal,
+			IKEProposal: defaultIKEProposal,
+			ESPOverhead: defaultESPOverhead,
+		},
+		conns: make(map[string]bool),
+		stop:  make(chan bool),
+	}
+
+	if len(configBlob) > 0 {
+		if err := json.Unmarshal(configBlob, &ib.cfg); err != nil {
+			log.Errorf("Error decoding ipsec backend config: %s", err)
+		}
+	}
+	if ib.cfg.ESPOverhead == 0 {
+		ib.cfg.ESPOverhead = defaultESPOverhead
+	}
+
+	return ib
+}
+
+func (ib *IpsecBackend) Init(extIface *net.Interface, extIaddr net.IP, extV6addr net.IP, ipMasq bool) (*backend.SubnetDef, error) {
+	attrs := &subnet.LeaseAttrs{
+		PublicIP:    ip.FromIP(extIaddr),
+		BackendType: "ipsec",
+	}
+	if extV6addr != nil {
+		attrs.PublicIPv6 = ip.FromIP6(extV6addr)
+	}
+
+	lease, _, err := ib.sm.AcquireLease(extIface, extIaddr, extV6addr, attrs, ib.stop)
+	if err != nil {
+		return nil, err
+	}
+	ib.lease = lease
+	ib.ourIP = attrs.PublicIP
+
+	v, err := dialVici()
+	if err != nil {
+		return nil, err
+	}
+	ib.vici = v
+
+	if err := ib.loadShared(); err != nil {
+		v.Close()
+		return nil, err
+	}
+
+	return &backend.SubnetDef{
+		Net: lease.Subnet,
+		MTU: extIface.MTU - ib.cfg.ESPOverhead,
+	}, nil
+}
+
+// request proxies to the vici client, transparently reconnecting once if
+// the socket was closed out from under us (e.g. charon restarted).
+func (ib *IpsecBackend) request(name string, args message) (message, error) {
+	resp, err := ib.vici.request(name, args)
+	if err == io.EOF {
+		log.Warnf("ipsec: vici connection lost, reconnecting")
+		ib.vici.Close()
+
+		v, dialErr := dialVici()
+		if dialErr != nil {
+			return nil, dialErr
+		}
+		ib.vici = v
+
+		resp, err = ib.vici.request(name, args)
+	}
+	return resp, err
+}
+
+func (ib *IpsecBackend) loadShared() error {
+	_, err := ib.request("load-shared", message{
+		"type": "IKE",
+		"data": ib.cfg.PSK,
+		"owners": []string{},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to load PSK into charon: %s", err)
+	}
+	return nil
+}
+
+func (ib *IpsecBackend) Run() {
+	ib.wg.Add(1)
+	defer ib.wg.Done()
+
+	receiver := make(chan subnet.Event)
+	ib.sm.WatchLeases(receiver, ib.stop)
+
+	for {
+		select {
+		case evt := <-receiver:
+			switch evt.Type {
+			case subnet.EventAdded:
+				if err := ib.addPeer(evt.Lease); err != nil {
+					log.Errorf("ipsec: failed to add peer %s: %s", evt.Lease.Subnet, err)
+					metrics.BackendErrorsTotal.WithLabelValues("ipsec").Inc()
+				}
+			case subnet.EventRemoved:
+				if err := ib.removePeer(evt.Lease); err != nil {
+					log.Errorf("ipsec: failed to remove peer %s: %s", evt.Lease.Subnet, err)
+					metrics.BackendErrorsTotal.WithLabelValues("ipsec").Inc()
+				}
+			}
+
+		case <-ib.stop:
+			return
+		}
+	}
+}
+
+func connName(l subnet.Lease) string {
+	return fmt.Sprintf("flannel-%s", l.Subnet.IP)
+}
+
+// encapFlag renders config.UDPEncap as vici's "yes"/"no" boolean form for
+// the IKE_SA's "encap" field, forcing UDP encapsulation of ESP even when
+// neither peer is behind NAT (useful when a firewall between hosts only
+// permits UDP).
+func encapFlag(enabled bool) string {
+	if enabled {
+		return "yes"
+	}
+	return "no"
+}
+
+// addPeer loads a conn+child SA for the peer's lease. Only one side
+// initiates, chosen deterministically by comparing public IPs, so we don't
+// end up with both hosts racing to bring the tunnel up.
+func (ib *IpsecBackend) addPeer(l subnet.Lease) error {
+	name := connName(l)
+
+	initiate := sortsLower(ib.ourIP, l.Attrs.PublicIP)
+
+	args := message{
+		"local": message{
+			"auth": "psk",
+			"id":   ib.lease.Attrs.PublicIP.String(),
+		},
+		"remote": message{
+			"auth": "psk",
+			"id":   l.Attrs.PublicIP.String(),
+		},
+		"local_addrs":  []string{ib.lease.Attrs.PublicIP.String()},
+		"remote_addrs": []string{l.Attrs.PublicIP.String()},
+		"version":      "2",
+		"proposals":    []string{ib.cfg.IKEProposal},
+		"encap":        encapFlag(ib.cfg.UDPEncap),
+		"children": message{
+			name: message{
+				"local_ts":      []string{ib.lease.Subnet.String()},
+				"remote_ts":     []string{l.Subnet.String()},
+				"esp_proposals": []string{ib.cfg.ESPProposal},
+				"mode":          "transport",
+			},
+		},
+	}
+
+	if _, err := ib.request("load-conn", message{name: args}); err != nil {
+		return err
+	}
+
+	ib.mu.Lock()
+	ib.conns[name] = true
+	ib.mu.Unlock()
+
+	if initiate {
+		if _, err := ib.request("initiate", message{
+			"child": name,
+			"ike":   name,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ib *IpsecBackend) removePeer(l subnet.Lease) error {
+	name := connName(l)
+
+	ib.request("terminate", message{"child": name})
+
+	if _, err := ib.request("unload-conn", message{"name": name}); err != nil {
+		return err
+	}
+
+	ib.mu.Lock()
+	delete(ib.conns, name)
+	ib.mu.Unlock()
+
+	return nil
+}
+
+// sortsLower decides which of two hosts should be the IKE initiator by
+// comparing their public IPv4 addresses lexically, so only one side ever
+// initiates for a given pair.
+func sortsLower(ours, theirs ip.IP4) bool {
+	return ours.String() < theirs.String()
+}
+
+func (ib *IpsecBackend) Stop() {
+	close(ib.stop)
+
+	ib.mu.Lock()
+	for name := range ib.conns {
+		ib.request("terminate", message{"child": name})
+		ib.request("unload-conn", message{"name": name})
+	}
+	ib.mu.Unlock()
+
+	if ib.vici != nil {
+		ib.vici.Close()
+	}
+	ib.wg.Wait()
+}
+
+func (ib *IpsecBackend) Name() string {
+	return "ipsec"
+}
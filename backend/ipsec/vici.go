@@ -0,0 +1,234 @@
+package ipsec
+
+// A small client for strongSwan's vici control protocol, just enough of it
+// to issue the handful of commands this backend needs (load-shared,
+// load-conn, initiate, terminate, unload-conn). See
+// src/libcharon/plugins/vici/README.md in the strongSwan tree for the wire
+// format this implements.
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+)
+
+const viciSocket = "/var/run/charon.vici"
+
+const (
+	pktCmdRequest  = 0
+	pktCmdResponse = 1
+	pktCmdUnknown  = 2
+	pktEvent       = 7
+)
+
+const (
+	elemSectionStart = 1
+	elemSectionEnd   = 2
+	elemKeyValue     = 3
+	elemListStart    = 4
+	elemListItem     = 5
+	elemListEnd      = 6
+)
+
+// message is a set of name/value pairs as used by vici requests and
+// responses; being a Go map, it does not keep the order of its entries.
+// Values are either a string, a []string (encoded as a vici list) or a
+// nested message (encoded as a vici section).
+type message map[string]interface{}
+
+type viciClient struct {
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+func dialVici() (*viciClient, error) {
+	conn, err := net.Dial("unix", viciSocket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to vici socket %s: %s", viciSocket, err)
+	}
+	return &viciClient{conn: conn}, nil
+}
+
+func (c *viciClient) Close() error {
+	return c.conn.Close()
+}
+
+// request sends a named command and waits for its response, returning the
+// decoded reply message. A reply whose "success" field is "no" is returned
+// as an error carrying the reply's "errmsg".
+func (c *viciClient) request(name string, args message) (message, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := writePacket(c.conn, pktCmdRequest, name, args); err != nil {
+		return nil, err
+	}
+
+	kind, _, body, err := readPacket(c.conn)
+	if err != nil {
+		return nil, err
+	}
+	if kind == pktCmdUnknown {
+		return nil, fmt.Errorf("vici: unknown command %q", name)
+	}
+
+	resp, err := decodeMessage(body)
+	if err != nil {
+		return nil, err
+	}
+	if resp["success"] == "no" {
+		return nil, fmt.Errorf("vici: %s failed: %v", name, resp["errmsg"])
+	}
+	return resp, nil
+}
+
+func writePacket(w net.Conn, kind byte, name string, args message) error {
+	var body []byte
+	body = append(body, kind)
+	if name != "" {
+		body = append(body, byte(len(name)))
+		body = append(body, []byte(name)...)
+	}
+	body = append(body, encodeMessage(args)...)
+
+	hdr := make([]byte, 4)
+	binary.BigEndian.PutUint32(hdr, uint32(len(body)))
+
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(body)
+	return err
+}
+
+func readPacket(r net.Conn) (kind byte, name string, body []byte, err error) {
+	br := bufio.NewReader(r)
+
+	hdr := make([]byte, 4)
+	if _, err = readFull(br, hdr); err != nil {
+		return
+	}
+	n := binary.BigEndian.Uint32(hdr)
+
+	buf := make([]byte, n)
+	if _, err = readFull(br, buf); err != nil {
+		return
+	}
+
+	if len(buf) == 0 {
+		return 0, "", nil, fmt.Errorf("vici: empty packet")
+	}
+
+	kind = buf[0]
+	rest := buf[1:]
+
+	if kind == pktCmdResponse || kind == pktCmdUnknown {
+		return kind, "", rest, nil
+	}
+
+	if len(rest) == 0 {
+		return kind, "", nil, nil
+	}
+	nameLen := int(rest[0])
+	if len(rest) < 1+nameLen {
+		return 0, "", nil, fmt.Errorf("vici: truncated packet")
+	}
+	return kind, string(rest[1 : 1+nameLen]), rest[1+nameLen:], nil
+}
+
+func readFull(r *bufio.Reader, buf []byte) (int, error) {
+	total := 0
+	for total < len(buf) {
+		n, err := r.Read(buf[total:])
+		total += n
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
+
+// encodeMessage flattens a message into vici's section/key-value/list wire
+// elements. Map iteration order is irrelevant here: each key is a distinct,
+// independent field as far as strongSwan's config parser is concerned.
+func encodeMessage(m message) []byte {
+	var out []byte
+	for k, v := range m {
+		switch val := v.(type) {
+		case string:
+			out = append(out, elemKeyValue)
+			out = appendLP(out, k)
+			out = appendLP32(out, val)
+		case []string:
+			out = append(out, elemListStart)
+			out = appendLP(out, k)
+			for _, item := range val {
+				out = append(out, elemListItem)
+				out = appendLP32(out, item)
+			}
+			out = append(out, elemListEnd)
+		case message:
+			out = append(out, elemSectionStart)
+			out = appendLP(out, k)
+			out = append(out, encodeMessage(val)...)
+			out = append(out, elemSectionEnd)
+		}
+	}
+	return out
+}
+
+func appendLP(b []byte, s string) []byte {
+	b = append(b, byte(len(s)))
+	return append(b, []byte(s)...)
+}
+
+func appendLP32(b []byte, s string) []byte {
+	lenBuf := make([]byte, 2)
+	binary.BigEndian.PutUint16(lenBuf, uint16(len(s)))
+	b = append(b, lenBuf...)
+	return append(b, []byte(s)...)
+}
+
+// decodeMessage is deliberately forgiving: it only extracts the top-level
+// key/value pairs (e.g. "success"/"errmsg", which is all request inspects
+// in a vici response) and stops at the first section or list, or at
+// truncated input, returning what it has decoded so far.
+func decodeMessage(b []byte) (message, error) {
+	m := message{}
+	i := 0
+	for i < len(b) {
+		switch b[i] {
+		case elemKeyValue:
+			i++
+			if i >= len(b) {
+				return m, nil
+			}
+			klen := int(b[i])
+			i++
+			if i+klen > len(b) {
+				return m, nil
+			}
+			key := string(b[i : i+klen])
+			i += klen
+			if i+2 > len(b) {
+				return m, nil
+			}
+			vlen := int(binary.BigEndian.Uint16(b[i : i+2]))
+			i += 2
+			if i+vlen > len(b) {
+				return m, nil
+			}
+			m[key] = string(b[i : i+vlen])
+			i += vlen
+		case elemSectionStart, elemListStart:
+			// skip name and recurse isn't needed for our purposes;
+			// just bail since we only care about top-level fields.
+			return m, nil
+		default:
+			return m, nil
+		}
+	}
+	return m, nil
+}
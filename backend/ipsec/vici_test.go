@@ -0,0 +1,87 @@
+package ipsec
+
+import (
+	"net"
+	"strings"
+	"testing"
+)
+
+// TestPacketKindConstants pins the vici wire values for CMD_RESPONSE and
+// CMD_UNKNOWN to strongSwan's actual protocol (see
+// src/libcharon/plugins/vici/README.md), so a future refactor can't
+// silently swap them again.
+func TestPacketKindConstants(t *testing.T) {
+	if pktCmdRequest != 0 {
+		t.Errorf("pktCmdRequest = %d, want 0", pktCmdRequest)
+	}
+	if pktCmdResponse != 1 {
+		t.Errorf("pktCmdResponse = %d, want 1", pktCmdResponse)
+	}
+	if pktCmdUnknown != 2 {
+		t.Errorf("pktCmdUnknown = %d, want 2", pktCmdUnknown)
+	}
+}
+
+func TestMessageEncodeDecodeRoundTrip(t *testing.T) {
+	in := message{
+		"success": "yes",
+		"errmsg":  "",
+	}
+
+	out, err := decodeMessage(encodeMessage(in))
+	if err != nil {
+		t.Fatalf("decodeMessage: %s", err)
+	}
+
+	for k, v := range in {
+		if out[k] != v {
+			t.Errorf("out[%q] = %q, want %q", k, out[k], v)
+		}
+	}
+}
+
+// TestRequestRoundTrip drives viciClient.request over a net.Pipe against a
+// fixed response packet, exercising the exact CMD_RESPONSE byte value a
+// real charon would send.
+func TestRequestRoundTrip(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		_, _, _, err := readPacket(server)
+		if err != nil {
+			return
+		}
+		writePacket(server, pktCmdResponse, "", message{"success": "yes"})
+	}()
+
+	c := &viciClient{conn: client}
+	resp, err := c.request("load-shared", message{"type": "IKE"})
+	if err != nil {
+		t.Fatalf("request returned error for a real CMD_RESPONSE packet: %s", err)
+	}
+	if resp["success"] != "yes" {
+		t.Errorf("resp[success] = %q, want %q", resp["success"], "yes")
+	}
+}
+
+func TestRequestUnknownCommand(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	go func() {
+		_, _, _, err := readPacket(server)
+		if err != nil {
+			return
+		}
+		writePacket(server, pktCmdUnknown, "", nil)
+	}()
+
+	c := &viciClient{conn: client}
+	_, err := c.request("bogus-command", message{})
+	if err == nil || !strings.Contains(err.Error(), "unknown command") {
+		t.Fatalf("request() error = %v, want an unknown command error", err)
+	}
+}
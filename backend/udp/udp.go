@@ -0,0 +1,134 @@
+// Package udp is the allocation-only precursor to flannel's userspace
+// UDP-encapsulation backend. It acquires and renews a subnet lease and opens
+// the UDP socket packets will eventually be proxied over, but does not yet
+// read from or write to a TUN device: no packets are actually forwarded.
+// Something else (e.g. a host route pointed at a real tunnel) must move
+// traffic until the TUN data plane is implemented.
+package udp
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/coreos/flannel/backend"
+	"github.com/coreos/flannel/pkg/ip"
+	"github.com/coreos/flannel/pkg/log"
+	"github.com/coreos/flannel/subnet"
+)
+
+const (
+	defaultPort = 8285
+)
+
+type config struct {
+	Port int
+}
+
+// UdpBackend is a backend.Backend that will eventually move packets over
+// plain UDP encapsulation; for now it only handles lease allocation and
+// holds the UDP socket open, and does not proxy any traffic itself. If the
+// network is configured for dual-stack, the IPv6 lease is still acquired
+// (so a secondary backend, e.g. ipsec, can make use of it).
+type UdpBackend struct {
+	sm    *subnet.SubnetManager
+	lease *subnet.Lease
+	cfg   config
+
+	conn *net.UDPConn
+	stop chan bool
+	wg   sync.WaitGroup
+}
+
+func New(sm *subnet.SubnetManager, configBlob json.RawMessage) backend.Backend {
+	ub := &UdpBackend{
+		sm:   sm,
+		cfg:  config{Port: defaultPort},
+		stop: make(chan bool),
+	}
+
+	if len(configBlob) > 0 {
+		if err := json.Unmarshal(configBlob, &ub.cfg); err != nil {
+			log.Errorf("Error decoding udp backend config, using defaults: %s", err)
+		}
+	}
+
+	return ub
+}
+
+func (ub *UdpBackend) Init(extIface *net.Interface, extIaddr net.IP, extV6addr net.IP, ipMasq bool) (*backend.SubnetDef, error) {
+	attrs := &subnet.LeaseAttrs{
+		PublicIP:    ip.FromIP(extIaddr),
+		BackendType: "udp",
+	}
+	if extV6addr != nil {
+		attrs.PublicIPv6 = ip.FromIP6(extV6addr)
+	}
+
+	v4Lease, v6Lease, err := ub.sm.AcquireLease(extIface, extIaddr, extV6addr, attrs, ub.stop)
+	if err != nil {
+		return nil, err
+	}
+	ub.lease = v4Lease
+
+	if extV6addr != nil && v6Lease == nil {
+		log.Warnf("udp backend: IPv6 requested but no IPv6 lease could be acquired; running IPv4-only")
+	} else if extV6addr != nil {
+		log.Warnf("udp backend: IPv6 lease acquired but this backend does not proxy IPv6 traffic; use a backend such as ipsec for the v6 data plane")
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: ub.cfg.Port})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open UDP socket on port %d: %s", ub.cfg.Port, err)
+	}
+	ub.conn = conn
+
+	sd := &backend.SubnetDef{
+		Net: v4Lease.Subnet,
+		MTU: extIface.MTU - encapOverhead,
+	}
+	if v6Lease != nil {
+		sd.IPv6Net = v6Lease.IPv6Subnet
+	}
+
+	return sd, nil
+}
+
+// encapOverhead is the per-packet byte cost of the outer IPv4+UDP header.
+const encapOverhead = 28
+
+func (ub *UdpBackend) Run() {
+	ub.wg.Add(1)
+	defer ub.wg.Done()
+
+	receiver := make(chan subnet.Event)
+	ub.sm.WatchLeases(receiver, ub.stop)
+
+	for {
+		select {
+		case evt := <-receiver:
+			switch evt.Type {
+			case subnet.EventAdded:
+				log.Infof("Subnet added: %s", evt.Lease.Subnet)
+			case subnet.EventRemoved:
+				log.Infof("Subnet removed: %s", evt.Lease.Subnet)
+			}
+
+		case <-ub.stop:
+			return
+		}
+	}
+}
+
+func (ub *UdpBackend) Stop() {
+	close(ub.stop)
+	if ub.conn != nil {
+		ub.conn.Close()
+	}
+	ub.wg.Wait()
+}
+
+func (ub *UdpBackend) Name() string {
+	return "udp"
+}
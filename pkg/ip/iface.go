@@ -0,0 +1,152 @@
+package ip
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// GetInterfaceByIP returns the interface that owns the given IP address
+func GetInterfaceByIP(ip net.IP) (*net.Interface, error) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, iface := range ifaces {
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			if addrIP, _, err := net.ParseCIDR(addr.String()); err == nil && addrIP.Equal(ip) {
+				return &iface, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("no interface with address %s", ip)
+}
+
+func GetIfaceIP4Addr(iface *net.Interface) (net.IP, error) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr.String())
+		if err != nil {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			return ip4, nil
+		}
+	}
+
+	return nil, errors.New("no IPv4 address found for given interface")
+}
+
+func GetIfaceIP6Addr(iface *net.Interface) (net.IP, error) {
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, addr := range addrs {
+		ip, _, err := net.ParseCIDR(addr.String())
+		if err != nil {
+			continue
+		}
+		if ip4 := ip.To4(); ip4 != nil {
+			continue
+		}
+		if ip.IsLinkLocalUnicast() {
+			continue
+		}
+		return ip, nil
+	}
+
+	return nil, errors.New("no IPv6 address found for given interface")
+}
+
+// GetDefaultGatewayIface returns the interface used by the IPv4 default route,
+// determined by parsing /proc/net/route.
+func GetDefaultGatewayIface() (*net.Interface, error) {
+	const f = "/proc/net/route"
+	file, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	// skip header line
+	scanner.Scan()
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 11 {
+			continue
+		}
+
+		// field 1 is destination, field 3 is flags
+		dest, err := strconv.ParseUint(fields[1], 16, 32)
+		if err != nil {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 16)
+		if err != nil {
+			continue
+		}
+
+		if dest != 0 || flags&0x2 == 0 {
+			continue
+		}
+
+		return net.InterfaceByName(fields[0])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("unable to find default route")
+}
+
+// GetDefaultGatewayIface6 returns the interface used by the IPv6 default
+// route, determined by parsing /proc/net/ipv6_route.
+func GetDefaultGatewayIface6() (*net.Interface, error) {
+	const f = "/proc/net/ipv6_route"
+	file, err := os.Open(f)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 10 {
+			continue
+		}
+
+		// field 0 is destination, all zero means default route
+		if fields[0] != strings.Repeat("0", 32) {
+			continue
+		}
+
+		return net.InterfaceByName(fields[9])
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, errors.New("unable to find IPv6 default route")
+}
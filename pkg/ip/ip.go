@@ -0,0 +1,150 @@
+package ip
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+)
+
+type IP4 uint32
+
+func FromBytes(ip []byte) IP4 {
+	return IP4(binary.BigEndian.Uint32(ip))
+}
+
+func FromIP(ip net.IP) IP4 {
+	return FromBytes(ip.To4())
+}
+
+func ParseIP4(s string) IP4 {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return IP4(0)
+	}
+	return FromIP(ip)
+}
+
+func (ip IP4) NetworkOrder() uint32 {
+	return binary.BigEndian.Uint32(ip.Octets())
+}
+
+func (ip IP4) Octets() []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(ip))
+	return b
+}
+
+func (ip IP4) ToIP() net.IP {
+	return net.IP(ip.Octets())
+}
+
+func (ip IP4) String() string {
+	return ip.ToIP().String()
+}
+
+func (ip IP4) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%s"`, ip)), nil
+}
+
+func (ip *IP4) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := jsonUnquote(b, &s); err != nil {
+		return err
+	}
+	*ip = ParseIP4(s)
+	return nil
+}
+
+func jsonUnquote(b []byte, s *string) error {
+	if len(b) < 2 || b[0] != '"' || b[len(b)-1] != '"' {
+		return fmt.Errorf("ip: malformed JSON string %q", b)
+	}
+	*s = string(b[1 : len(b)-1])
+	return nil
+}
+
+// IP4Net is an IPv4 address/prefix-length pair, e.g. 10.1.2.0/24
+type IP4Net struct {
+	IP        IP4
+	PrefixLen uint
+}
+
+func (n IP4Net) String() string {
+	return fmt.Sprintf("%s/%d", n.IP, n.PrefixLen)
+}
+
+func (n IP4Net) Network() net.IPNet {
+	return net.IPNet{
+		IP:   n.IP.ToIP(),
+		Mask: net.CIDRMask(int(n.PrefixLen), 32),
+	}
+}
+
+func (n IP4Net) Empty() bool {
+	return n.IP == IP4(0) && n.PrefixLen == 0
+}
+
+// IP6 holds a 128-bit IPv6 address
+type IP6 [16]byte
+
+func FromIP6(ip net.IP) IP6 {
+	var r IP6
+	copy(r[:], ip.To16())
+	return r
+}
+
+func ParseIP6(s string) IP6 {
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return IP6{}
+	}
+	return FromIP6(ip)
+}
+
+func (ip IP6) ToIP() net.IP {
+	b := make([]byte, 16)
+	copy(b, ip[:])
+	return net.IP(b)
+}
+
+func (ip IP6) String() string {
+	return ip.ToIP().String()
+}
+
+func (ip IP6) Empty() bool {
+	return ip == IP6{}
+}
+
+func (ip IP6) MarshalJSON() ([]byte, error) {
+	return []byte(fmt.Sprintf(`"%s"`, ip)), nil
+}
+
+func (ip *IP6) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := jsonUnquote(b, &s); err != nil {
+		return err
+	}
+	*ip = ParseIP6(s)
+	return nil
+}
+
+// IP6Net is an IPv6 address/prefix-length pair, e.g. fd00:100::/56
+type IP6Net struct {
+	IP        IP6
+	PrefixLen uint
+}
+
+func (n IP6Net) String() string {
+	return fmt.Sprintf("%s/%d", n.IP, n.PrefixLen)
+}
+
+func (n IP6Net) Network() net.IPNet {
+	return net.IPNet{
+		IP:   n.IP.ToIP(),
+		Mask: net.CIDRMask(int(n.PrefixLen), 128),
+	}
+}
+
+func (n IP6Net) Empty() bool {
+	return n.IP.Empty() && n.PrefixLen == 0
+}
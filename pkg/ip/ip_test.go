@@ -0,0 +1,77 @@
+package ip
+
+import "testing"
+
+func TestIP4StringRoundTrip(t *testing.T) {
+	in := "10.1.2.3"
+	ip4 := ParseIP4(in)
+	if ip4.String() != in {
+		t.Errorf("ParseIP4(%q).String() = %q, want %q", in, ip4.String(), in)
+	}
+}
+
+func TestIP4MarshalUnmarshalJSON(t *testing.T) {
+	in := ParseIP4("10.1.2.3")
+
+	b, err := in.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %s", err)
+	}
+
+	var out IP4
+	if err := out.UnmarshalJSON(b); err != nil {
+		t.Fatalf("UnmarshalJSON(%s): %s", b, err)
+	}
+	if out != in {
+		t.Errorf("round trip = %s, want %s", out, in)
+	}
+}
+
+func TestIP4NetString(t *testing.T) {
+	n := IP4Net{IP: ParseIP4("10.1.2.0"), PrefixLen: 24}
+	if got, want := n.String(), "10.1.2.0/24"; got != want {
+		t.Errorf("IP4Net.String() = %q, want %q", got, want)
+	}
+}
+
+func TestIP6StringRoundTrip(t *testing.T) {
+	in := "fd00:100::1"
+	ip6 := ParseIP6(in)
+	if ip6.String() != in {
+		t.Errorf("ParseIP6(%q).String() = %q, want %q", in, ip6.String(), in)
+	}
+}
+
+func TestIP6MarshalUnmarshalJSON(t *testing.T) {
+	in := ParseIP6("fd00:100::1")
+
+	b, err := in.MarshalJSON()
+	if err != nil {
+		t.Fatalf("MarshalJSON: %s", err)
+	}
+
+	var out IP6
+	if err := out.UnmarshalJSON(b); err != nil {
+		t.Fatalf("UnmarshalJSON(%s): %s", b, err)
+	}
+	if out != in {
+		t.Errorf("round trip = %s, want %s", out, in)
+	}
+}
+
+func TestIP6NetString(t *testing.T) {
+	n := IP6Net{IP: ParseIP6("fd00:100::"), PrefixLen: 56}
+	if got, want := n.String(), "fd00:100::/56"; got != want {
+		t.Errorf("IP6Net.String() = %q, want %q", got, want)
+	}
+}
+
+func TestIP6Empty(t *testing.T) {
+	var n IP6Net
+	if !n.Empty() {
+		t.Error("zero-value IP6Net should be Empty")
+	}
+	if n2 := (IP6Net{IP: ParseIP6("fd00:100::1"), PrefixLen: 64}); n2.Empty() {
+		t.Error("non-zero IP6Net should not be Empty")
+	}
+}
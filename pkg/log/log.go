@@ -0,0 +1,69 @@
+// Package log is the leveled logging facade used throughout flannel. It
+// exists so the module doesn't hard-code glog: the default implementation
+// formats and writes its timestamped lines itself with fmt (it does not go
+// through the standard library "log" package), but anything embedding flannel
+// (see pkg/trafficmanager) can call SetBackend to route output through its
+// own logger instead.
+package log
+
+import (
+	"sync"
+)
+
+// Logger is the logging surface every backend (default or injected) must
+// implement.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+var (
+	mu      sync.RWMutex
+	current Logger = newStdLogger()
+)
+
+// SetBackend swaps the Logger every package-level call in this package
+// delegates to. It's meant to be called once, early in process startup.
+func SetBackend(l Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+	current = l
+}
+
+func get() Logger {
+	mu.RLock()
+	defer mu.RUnlock()
+	return current
+}
+
+// SetLevel toggles which levels are enabled on the default stdLogger backend
+// from a comma-separated list, e.g. "debug,info,warn,error". It has no
+// effect if a custom backend was installed via SetBackend.
+func SetLevel(levels string) {
+	if sl, ok := get().(*stdLogger); ok {
+		sl.setLevel(levels)
+	}
+}
+
+// SetOutput redirects the default stdLogger backend's output, e.g. to the
+// file named by --log-file. It has no effect if a custom backend was
+// installed via SetBackend.
+func SetOutput(path string) error {
+	sl, ok := get().(*stdLogger)
+	if !ok {
+		return nil
+	}
+	return sl.setOutputFile(path)
+}
+
+func Debugf(format string, args ...interface{}) { get().Debugf(format, args...) }
+func Infof(format string, args ...interface{})  { get().Infof(format, args...) }
+func Warnf(format string, args ...interface{})  { get().Warnf(format, args...) }
+func Errorf(format string, args ...interface{}) { get().Errorf(format, args...) }
+
+// Info and Error are the fmt.Sprint-style counterparts kept around for call
+// sites that don't format, matching the glog API they replace.
+func Info(args ...interface{})  { get().Infof("%s", sprint(args...)) }
+func Error(args ...interface{}) { get().Errorf("%s", sprint(args...)) }
@@ -0,0 +1,48 @@
+// Package metrics holds the Prometheus collectors flannel exposes on
+// --listen's /metrics endpoint. They're package-level so any backend or the
+// subnet manager can record against them without threading a registry
+// through every constructor.
+package metrics
+
+import (
+	"github.com/coreos/flannel/Godeps/_workspace/src/github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	// LeaseExpirySeconds is the Unix timestamp at which this host's current
+	// IPv4 lease expires, so `time() - flannel_subnet_lease_expiry_seconds`
+	// graphs time-to-expiry.
+	LeaseExpirySeconds = prometheus.NewGauge(prometheus.GaugeOpts{
+		Name: "flannel_subnet_lease_expiry_seconds",
+		Help: "Unix timestamp at which this host's subnet lease expires",
+	})
+
+	WatchEventsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "flannel_subnet_watch_events_total",
+		Help: "Number of lease watch events observed, by event type",
+	}, []string{"event"})
+
+	BackendErrorsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "flannel_backend_errors_total",
+		Help: "Number of errors encountered by a backend",
+	}, []string{"backend"})
+
+	UdpProxyPacketsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "flannel_udp_proxy_packets_total",
+		Help: "Number of packets relayed by the udp backend, by direction",
+	}, []string{"direction"})
+
+	EtcdRequestDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "flannel_etcd_request_duration_seconds",
+		Help:    "Time taken by requests against etcd",
+		Buckets: prometheus.DefBuckets,
+	})
+)
+
+func init() {
+	prometheus.MustRegister(LeaseExpirySeconds)
+	prometheus.MustRegister(WatchEventsTotal)
+	prometheus.MustRegister(BackendErrorsTotal)
+	prometheus.MustRegister(UdpProxyPacketsTotal)
+	prometheus.MustRegister(EtcdRequestDuration)
+}
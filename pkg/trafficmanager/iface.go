@@ -0,0 +1,68 @@
+package trafficmanager
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/coreos/flannel/pkg/ip"
+)
+
+// defaultIfaceLookup is the lookupIface logic that used to live directly in
+// main.go. It's used when Options.IfaceLookup is nil; embedders can set that
+// field to swap in their own (e.g. one driven by Kubernetes node status)
+// without forking this package.
+func defaultIfaceLookup(iface, ifaceV6 string) (*net.Interface, net.IP, net.IP, error) {
+	var extIface *net.Interface
+	var ipaddr net.IP
+	var err error
+
+	if len(iface) > 0 {
+		if ipaddr = net.ParseIP(iface); ipaddr != nil {
+			extIface, err = ip.GetInterfaceByIP(ipaddr)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("error looking up interface %s: %s", iface, err)
+			}
+		} else {
+			extIface, err = net.InterfaceByName(iface)
+			if err != nil {
+				return nil, nil, nil, fmt.Errorf("error looking up interface %s: %s", iface, err)
+			}
+		}
+	} else {
+		if extIface, err = ip.GetDefaultGatewayIface(); err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to get default interface: %s", err)
+		}
+	}
+
+	if ipaddr == nil {
+		ipaddr, err = ip.GetIfaceIP4Addr(extIface)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("failed to find IPv4 address for interface %s", extIface.Name)
+		}
+	}
+
+	var ip6addr net.IP
+	if len(ifaceV6) > 0 {
+		iface6 := extIface
+		if v6 := net.ParseIP(ifaceV6); v6 != nil {
+			if iface6, err = ip.GetInterfaceByIP(v6); err != nil {
+				return nil, nil, nil, fmt.Errorf("error looking up IPv6 interface %s: %s", ifaceV6, err)
+			}
+			ip6addr = v6
+		} else if iface6, err = net.InterfaceByName(ifaceV6); err != nil {
+			return nil, nil, nil, fmt.Errorf("error looking up IPv6 interface %s: %s", ifaceV6, err)
+		}
+
+		if ip6addr == nil {
+			if ip6addr, err = ip.GetIfaceIP6Addr(iface6); err != nil {
+				return nil, nil, nil, fmt.Errorf("failed to find IPv6 address for interface %s", iface6.Name)
+			}
+		}
+	} else if v6, err := ip.GetIfaceIP6Addr(extIface); err == nil {
+		// -iface-v6 defaults to the IPv6 address on -iface; it's not an
+		// error for that interface to simply have none.
+		ip6addr = v6
+	}
+
+	return extIface, ipaddr, ip6addr, nil
+}
@@ -0,0 +1,27 @@
+package trafficmanager
+
+import (
+	"github.com/coreos/flannel/pkg/log"
+)
+
+// defaultLogger is used when Options.Logger is left nil, so TrafficManager
+// logs through this module's pkg/log facade by default.
+type defaultLogger struct{}
+
+func (defaultLogger) Infof(format string, args ...interface{})  { log.Infof(format, args...) }
+func (defaultLogger) Warnf(format string, args ...interface{})  { log.Warnf(format, args...) }
+func (defaultLogger) Errorf(format string, args ...interface{}) { log.Errorf(format, args...) }
+
+// logBackendAdapter makes an Options.Logger satisfy pkg/log.Logger, so it
+// can be installed via log.SetBackend and pick up the package-level
+// log.Errorf/Warnf/etc. calls made throughout subnet and the backends, not
+// just the handful of tm.log calls inside this package. Logger has no
+// Debugf of its own, so debug-level messages are folded into Infof.
+type logBackendAdapter struct {
+	l Logger
+}
+
+func (a logBackendAdapter) Debugf(format string, args ...interface{}) { a.l.Infof(format, args...) }
+func (a logBackendAdapter) Infof(format string, args ...interface{})  { a.l.Infof(format, args...) }
+func (a logBackendAdapter) Warnf(format string, args ...interface{})  { a.l.Warnf(format, args...) }
+func (a logBackendAdapter) Errorf(format string, args ...interface{}) { a.l.Errorf(format, args...) }
@@ -0,0 +1,61 @@
+package trafficmanager
+
+import (
+	"encoding/json"
+	"net"
+
+	"github.com/coreos/flannel/backend"
+	"github.com/coreos/flannel/subnet"
+)
+
+// BackendFactory builds a backend.Backend given the SubnetManager it should
+// lease from and the (possibly nil) backend-specific config blob from the
+// etcd network config.
+type BackendFactory func(sm *subnet.SubnetManager, config json.RawMessage) backend.Backend
+
+// IfaceLookupFunc resolves the external interface (and, optionally, IPv6
+// address) flannel should use for inter-host traffic. The iface/ifaceV6
+// arguments mirror the -iface/-iface-v6 flags: an IP or an interface name.
+// An empty iface falls back to the default route's interface; the default
+// lookup treats an empty ifaceV6 as the IPv6 address on that interface, if
+// it has one.
+type IfaceLookupFunc func(iface, ifaceV6 string) (extIface *net.Interface, extIaddr net.IP, extV6addr net.IP, err error)
+
+// Logger is the minimal logging surface TrafficManager needs. Embedders
+// that want to route flannel's log output through their own logger
+// implement this themselves and pass it in via Options.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// Options configures a TrafficManager. Everything that main.go used to read
+// out of package-level flag variables is threaded through here instead, so
+// a TrafficManager never reaches for globals.
+type Options struct {
+	EtcdEndpoints []string
+	EtcdPrefix    string
+
+	Iface   string
+	IfaceV6 string
+	IPMasq  bool
+
+	SubnetFile string
+
+	// BackendRegistry maps a backend's etcd "Type" name (e.g. "udp") to a
+	// constructor for it. Callers that only need the built-in backends can
+	// leave this nil to get DefaultBackendRegistry().
+	BackendRegistry map[string]BackendFactory
+
+	// IfaceLookup overrides how the external interface/addresses are
+	// resolved. Leave nil to use the default /proc/net/route-based lookup.
+	IfaceLookup IfaceLookupFunc
+
+	// SubnetFileWriter overrides how the lease is persisted for
+	// out-of-process consumers (e.g. CNI plugins reading subnet.env).
+	// Leave nil to use the default env-file writer at SubnetFile.
+	SubnetFileWriter func(sn *backend.SubnetDef) error
+
+	Logger Logger
+}
@@ -0,0 +1,28 @@
+package trafficmanager
+
+import (
+	"encoding/json"
+
+	"github.com/coreos/flannel/backend"
+	"github.com/coreos/flannel/backend/alloc"
+	"github.com/coreos/flannel/backend/ipsec"
+	"github.com/coreos/flannel/backend/udp"
+	"github.com/coreos/flannel/subnet"
+)
+
+// DefaultBackendRegistry returns the set of backends flannel ships
+// out-of-the-box. Pass a custom registry in Options.BackendRegistry to add
+// or replace backends without forking this package.
+func DefaultBackendRegistry() map[string]BackendFactory {
+	return map[string]BackendFactory{
+		"udp": func(sm *subnet.SubnetManager, config json.RawMessage) backend.Backend {
+			return udp.New(sm, config)
+		},
+		"alloc": func(sm *subnet.SubnetManager, config json.RawMessage) backend.Backend {
+			return alloc.New(sm)
+		},
+		"ipsec": func(sm *subnet.SubnetManager, config json.RawMessage) backend.Backend {
+			return ipsec.New(sm, config)
+		},
+	}
+}
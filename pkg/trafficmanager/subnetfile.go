@@ -0,0 +1,47 @@
+package trafficmanager
+
+import (
+	"fmt"
+	"os"
+	"path"
+
+	"github.com/coreos/flannel/backend"
+)
+
+// defaultSubnetFileWriter is the writeSubnetFile logic that used to live
+// directly in main.go, now parameterized by the destination path instead
+// of a package-level flag.
+func defaultSubnetFileWriter(subnetFile string) func(sn *backend.SubnetDef) error {
+	return func(sn *backend.SubnetDef) error {
+		snet := sn.Net
+		snet.IP += 1
+
+		dir, _ := path.Split(subnetFile)
+		os.MkdirAll(dir, 0755)
+
+		f, err := os.Create(subnetFile)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		if _, err = fmt.Fprintf(f, "FLANNEL_SUBNET=%s\n", snet); err != nil {
+			return err
+		}
+		if _, err = fmt.Fprintf(f, "FLANNEL_MTU=%d\n", sn.MTU); err != nil {
+			return err
+		}
+
+		if !sn.IPv6Net.Empty() {
+			sn6 := sn.IPv6Net
+			if _, err = fmt.Fprintf(f, "FLANNEL_IPV6_SUBNET=%s\n", sn6); err != nil {
+				return err
+			}
+			if _, err = fmt.Fprintf(f, "FLANNEL_IPV6_NETWORK=%s\n", sn6.Network()); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
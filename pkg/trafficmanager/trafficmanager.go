@@ -0,0 +1,204 @@
+// Package trafficmanager provides an embeddable flannel: everything main.go
+// used to own directly (flag-driven setup, backend selection, subnet-file
+// writing, the Run/Stop lifecycle) lives here behind a small interface, so
+// a host process can drive flannel under its own context and read the
+// resulting lease back directly instead of parsing subnet.env.
+package trafficmanager
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/coreos/flannel/Godeps/_workspace/src/github.com/coreos/go-systemd/daemon"
+
+	"github.com/coreos/flannel/backend"
+	"github.com/coreos/flannel/pkg/log"
+	"github.com/coreos/flannel/pkg/metrics"
+	"github.com/coreos/flannel/subnet"
+)
+
+// TrafficManager owns one flannel backend's lifecycle: acquiring a lease,
+// running its data plane, and exposing the result.
+type TrafficManager interface {
+	// Run blocks until ctx is canceled or the backend fails. It acquires
+	// the lease, writes it out via Options.SubnetFileWriter, and then runs
+	// the backend until told to stop.
+	Run(ctx context.Context) error
+
+	// Lease returns this host's current lease, or nil before Run has
+	// finished initializing.
+	Lease() *backend.SubnetDef
+
+	// ReloadConfig checks that a network config blob (the same shape as
+	// the etcd Config) is a well-formed JSON object, without restarting
+	// the backend, and logs that the backend must be restarted to pick it
+	// up. It does not check the blob's fields against Config and does not
+	// apply it to the running backend.
+	ReloadConfig(cfg []byte) error
+
+	// Healthy reports whether the backend finished initializing and the
+	// lease watch is still making progress. --listen's /healthz handler
+	// calls this directly.
+	Healthy() bool
+}
+
+type trafficManager struct {
+	opts Options
+	log  Logger
+
+	sm *subnet.SubnetManager
+	be backend.Backend
+
+	mu          sync.RWMutex
+	lease       *backend.SubnetDef
+	initialized bool
+}
+
+// New builds a TrafficManager from structured Options. It connects to etcd
+// and selects a backend but does not acquire a lease or start anything
+// until Run is called.
+func New(opts Options) (TrafficManager, error) {
+	if opts.BackendRegistry == nil {
+		opts.BackendRegistry = DefaultBackendRegistry()
+	}
+	if opts.IfaceLookup == nil {
+		opts.IfaceLookup = defaultIfaceLookup
+	}
+	if opts.SubnetFileWriter == nil {
+		opts.SubnetFileWriter = defaultSubnetFileWriter(opts.SubnetFile)
+	}
+
+	l := opts.Logger
+	if l == nil {
+		l = defaultLogger{}
+	} else {
+		// Route subnet/backend log output (all of it goes through
+		// pkg/log's package-level calls, not through Logger directly)
+		// to the embedder's logger too.
+		log.SetBackend(logBackendAdapter{l})
+	}
+
+	sm, err := newSubnetManager(opts.EtcdEndpoints, opts.EtcdPrefix, l)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := sm.GetConfig()
+
+	var bt struct{ Type string }
+	if len(cfg.Backend) > 0 {
+		if err := json.Unmarshal(cfg.Backend, &bt); err != nil {
+			return nil, fmt.Errorf("error decoding Backend property of config: %v", err)
+		}
+	} else {
+		bt.Type = "udp"
+	}
+
+	factory, ok := opts.BackendRegistry[strings.ToLower(bt.Type)]
+	if !ok {
+		return nil, fmt.Errorf("%q: unknown backend type", bt.Type)
+	}
+
+	return &trafficManager{
+		opts: opts,
+		log:  l,
+		sm:   sm,
+		be:   factory(sm, cfg.Backend),
+	}, nil
+}
+
+func newSubnetManager(endpoints []string, prefix string, l Logger) (*subnet.SubnetManager, error) {
+	for {
+		sm, err := subnet.NewSubnetManager(endpoints, prefix)
+		if err == nil {
+			return sm, nil
+		}
+
+		l.Errorf("Failed to create SubnetManager: %s", err)
+		time.Sleep(time.Second)
+	}
+}
+
+func (tm *trafficManager) Run(ctx context.Context) error {
+	extIface, extIaddr, extV6addr, err := tm.opts.IfaceLookup(tm.opts.Iface, tm.opts.IfaceV6)
+	if err != nil {
+		return err
+	}
+
+	if extIface.MTU == 0 {
+		return fmt.Errorf("failed to determine MTU for %s interface", extIaddr)
+	}
+
+	tm.log.Infof("Using %s as external interface", extIaddr)
+	if extV6addr != nil {
+		tm.log.Infof("Using %s as external IPv6 address", extV6addr)
+	}
+
+	sn, err := tm.be.Init(extIface, extIaddr, extV6addr, tm.opts.IPMasq)
+	if err != nil {
+		metrics.BackendErrorsTotal.WithLabelValues(tm.be.Name()).Inc()
+		return fmt.Errorf("could not init %s backend: %s", tm.be.Name(), err)
+	}
+
+	tm.mu.Lock()
+	tm.lease = sn
+	tm.initialized = true
+	tm.mu.Unlock()
+
+	if err := tm.opts.SubnetFileWriter(sn); err != nil {
+		return err
+	}
+	daemon.SdNotify("READY=1")
+
+	tm.log.Infof("%s mode initialized", tm.be.Name())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		tm.be.Run()
+	}()
+
+	select {
+	case <-ctx.Done():
+		tm.be.Stop()
+		<-done
+		return ctx.Err()
+	case <-done:
+		return nil
+	}
+}
+
+func (tm *trafficManager) Lease() *backend.SubnetDef {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.lease
+}
+
+// Healthy returns true once Init has succeeded and the lease watch's last
+// long-poll returned within 2x the lease-renewal interval, i.e. it hasn't
+// silently wedged against etcd.
+func (tm *trafficManager) Healthy() bool {
+	tm.mu.RLock()
+	initialized := tm.initialized
+	tm.mu.RUnlock()
+
+	if !initialized {
+		return false
+	}
+
+	return tm.sm.LastPollAge() < 2*tm.sm.RenewInterval()
+}
+
+func (tm *trafficManager) ReloadConfig(cfg []byte) error {
+	var generic map[string]interface{}
+	if err := json.Unmarshal(cfg, &generic); err != nil {
+		return fmt.Errorf("invalid network config: %s", err)
+	}
+
+	tm.log.Warnf("ReloadConfig received but the %s backend must be restarted to pick up network config changes", tm.be.Name())
+	return nil
+}
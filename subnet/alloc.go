@@ -0,0 +1,50 @@
+package subnet
+
+import "github.com/coreos/flannel/pkg/ip"
+
+// allocateSubnet picks the i'th /subnetLen subnet out of network. Callers
+// retry with increasing i until an unused one is found (a Create against
+// etcd fails if it's already taken).
+func allocateSubnet(network ip.IP4Net, subnetLen uint, i int) ip.IP4Net {
+	base := uint32(network.IP)
+	step := uint32(1) << (32 - subnetLen)
+	return ip.IP4Net{
+		IP:        ip.IP4(base + step*uint32(i)),
+		PrefixLen: subnetLen,
+	}
+}
+
+// allocateSubnet6 is the IPv6 analogue of allocateSubnet, carving a
+// subnetLen-bit subnet out of network by adding i times the per-subnet
+// step, 2^(128-subnetLen), to network's 128-bit address.
+func allocateSubnet6(network ip.IP6Net, subnetLen uint, i int) ip.IP6Net {
+	var sub ip.IP6
+	copy(sub[:], network.IP[:])
+
+	addIP6Offset(&sub, uint64(i), int(128-subnetLen))
+
+	return ip.IP6Net{IP: sub, PrefixLen: subnetLen}
+}
+
+// addIP6Offset adds offset<<shift, treated as a 128-bit big-endian integer,
+// to ip in place, carrying across byte boundaries. Go's shift operators
+// yield 0 for a shift count >= the operand's width, so bytes the offset
+// doesn't reach contribute nothing even when shift isn't byte-aligned.
+func addIP6Offset(ip *ip.IP6, offset uint64, shift int) {
+	carry := uint64(0)
+	for p := 0; p < 16; p++ {
+		idx := 15 - p
+		delta := shift - 8*p
+
+		var contrib uint64
+		if delta >= 0 {
+			contrib = (offset << uint(delta)) & 0xff
+		} else {
+			contrib = (offset >> uint(-delta)) & 0xff
+		}
+
+		sum := uint64(ip[idx]) + contrib + carry
+		ip[idx] = byte(sum)
+		carry = sum >> 8
+	}
+}
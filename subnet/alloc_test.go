@@ -0,0 +1,42 @@
+package subnet
+
+import (
+	"testing"
+
+	"github.com/coreos/flannel/pkg/ip"
+)
+
+func TestAllocateSubnet(t *testing.T) {
+	network := ip.IP4Net{IP: ip.ParseIP4("10.1.0.0"), PrefixLen: 16}
+
+	for i, want := range []string{"10.1.0.0/24", "10.1.1.0/24", "10.1.2.0/24"} {
+		sn := allocateSubnet(network, 24, i)
+		if sn.String() != want {
+			t.Errorf("allocateSubnet(i=%d) = %s, want %s", i, sn, want)
+		}
+	}
+}
+
+func TestAllocateSubnet6(t *testing.T) {
+	network := ip.IP6Net{IP: ip.ParseIP6("fd00:100::"), PrefixLen: 56}
+
+	for i, want := range []string{"fd00:100::/56", "fd00:100:0:100::/56", "fd00:100:0:200::/56"} {
+		sn := allocateSubnet6(network, 56, i)
+		if sn.String() != want {
+			t.Errorf("allocateSubnet6(i=%d) = %s, want %s", i, sn, want)
+		}
+	}
+}
+
+// TestAllocateSubnet6NotByteAligned covers a subnetLen that doesn't land on
+// a byte boundary, where the per-subnet step isn't a whole-byte increment.
+func TestAllocateSubnet6NotByteAligned(t *testing.T) {
+	network := ip.IP6Net{IP: ip.ParseIP6("fd00:100::"), PrefixLen: 60}
+
+	for i, want := range []string{"fd00:100::/60", "fd00:100:0:10::/60", "fd00:100:0:20::/60"} {
+		sn := allocateSubnet6(network, 60, i)
+		if sn.String() != want {
+			t.Errorf("allocateSubnet6(i=%d) = %s, want %s", i, sn, want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package subnet
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/coreos/flannel/pkg/ip"
+)
+
+// Config is the user-supplied network configuration stored at
+// <prefix>/config (IPv4) and, when EnableIPv6 is set, mirrored for IPv6
+// parameters at <prefix>/config-v6.
+type Config struct {
+	Network   ip.IP4Net
+	SubnetMin ip.IP4
+	SubnetMax ip.IP4
+	SubnetLen uint
+	Backend   json.RawMessage
+
+	EnableIPv6    bool
+	IPv6Network   ip.IP6Net
+	IPv6SubnetLen uint
+}
+
+func parseConfig(s string) (*Config, error) {
+	cfg := new(Config)
+	if err := json.Unmarshal([]byte(s), cfg); err != nil {
+		return nil, fmt.Errorf("error parsing subnet config: %s", err)
+	}
+
+	if cfg.SubnetLen == 0 {
+		cfg.SubnetLen = 24
+	}
+
+	if cfg.IPv6SubnetLen == 0 {
+		cfg.IPv6SubnetLen = 64
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,338 @@
+// Package subnet manages this host's lease(s) of a slice of the overall
+// flannel network, backed by etcd. A SubnetManager hands out one IPv4
+// subnet per host and, when the network config enables it, a second IPv6
+// subnet from a parallel pool.
+package subnet
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	etcd "github.com/coreos/flannel/Godeps/_workspace/src/github.com/coreos/go-etcd/etcd"
+
+	"github.com/coreos/flannel/pkg/ip"
+	"github.com/coreos/flannel/pkg/log"
+	"github.com/coreos/flannel/pkg/metrics"
+)
+
+const (
+	registerRetries = 10
+	subnetTTL       = 24 * time.Hour
+	renewMargin     = time.Hour
+)
+
+// LeaseAttrs is the backend-opaque metadata that travels with a lease so
+// peers can find out how to reach us.
+type LeaseAttrs struct {
+	PublicIP    ip.IP4
+	PublicIPv6  ip.IP6          `json:",omitempty"`
+	BackendType string          `json:",omitempty"`
+	BackendData json.RawMessage `json:",omitempty"`
+}
+
+// Lease is one host's slice of the overlay network.
+type Lease struct {
+	Subnet     ip.IP4Net
+	IPv6Subnet ip.IP6Net
+	Attrs      LeaseAttrs
+	Expiration time.Time
+}
+
+type EventType int
+
+const (
+	EventAdded EventType = iota
+	EventRemoved
+)
+
+type Event struct {
+	Type  EventType
+	Lease Lease
+}
+
+// SubnetManager hands out and renews this host's lease(s) against etcd.
+type SubnetManager struct {
+	registry  *etcd.Client
+	prefix    string
+	cfg       *Config
+	myLease   Lease
+	myLeaseV6 Lease
+
+	pollMu   sync.RWMutex
+	lastPoll time.Time
+}
+
+func NewSubnetManager(etcdEndpoints []string, prefix string) (*SubnetManager, error) {
+	r := etcd.NewClient(etcdEndpoints)
+	sm := &SubnetManager{registry: r, prefix: prefix}
+
+	cfg, err := sm.fetchConfig()
+	if err != nil {
+		return nil, err
+	}
+	sm.cfg = cfg
+
+	return sm, nil
+}
+
+// timeRequest runs fn, an etcd client call, and records how long it took
+// under flannel_etcd_request_duration_seconds.
+func timeRequest(fn func() error) error {
+	start := time.Now()
+	err := fn()
+	metrics.EtcdRequestDuration.Observe(time.Since(start).Seconds())
+	return err
+}
+
+// RenewInterval is how often a lease is renewed, i.e. subnetTTL with its
+// safety margin subtracted. /healthz uses it to judge whether WatchLeases
+// is still making progress.
+func (sm *SubnetManager) RenewInterval() time.Duration {
+	return subnetTTL - renewMargin
+}
+
+// LastPollAge is how long it's been since a WatchLeases watch last started
+// or delivered a response from etcd. It is 0 before WatchLeases has been
+// called.
+func (sm *SubnetManager) LastPollAge() time.Duration {
+	sm.pollMu.RLock()
+	defer sm.pollMu.RUnlock()
+	if sm.lastPoll.IsZero() {
+		return time.Duration(0)
+	}
+	return time.Since(sm.lastPoll)
+}
+
+func (sm *SubnetManager) markPoll() {
+	sm.pollMu.Lock()
+	sm.lastPoll = time.Now()
+	sm.pollMu.Unlock()
+}
+
+func (sm *SubnetManager) fetchConfig() (*Config, error) {
+	var resp *etcd.Response
+	err := timeRequest(func() error {
+		var err error
+		resp, err = sm.registry.Get(path.Join(sm.prefix, "config"), false, false)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch network config: %s", err)
+	}
+
+	cfg, err := parseConfig(resp.Node.Value)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.EnableIPv6 {
+		if resp6, err := sm.registry.Get(path.Join(sm.prefix, "config-v6"), false, false); err == nil {
+			if cfg6, err := parseConfig(resp6.Node.Value); err == nil {
+				cfg.IPv6Network = cfg6.IPv6Network
+				if cfg6.IPv6SubnetLen != 0 {
+					cfg.IPv6SubnetLen = cfg6.IPv6SubnetLen
+				}
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+func (sm *SubnetManager) GetConfig() *Config {
+	return sm.cfg
+}
+
+// AcquireLease registers this host's lease(s) with etcd and starts the
+// background renewal loop(s). If the config has IPv6 enabled, a second
+// lease is acquired from the config-v6 pool and renewed independently.
+func (sm *SubnetManager) AcquireLease(extIface *net.Interface, extIaddr net.IP, extV6addr net.IP, attrs *LeaseAttrs, stop chan bool) (*Lease, *Lease, error) {
+	v4Lease, err := sm.acquireLeaseFor(path.Join(sm.prefix, "subnets"), sm.cfg.Network, sm.cfg.SubnetLen, attrs, stop)
+	if err != nil {
+		return nil, nil, err
+	}
+	sm.myLease = *v4Lease
+
+	if !sm.cfg.EnableIPv6 {
+		return v4Lease, nil, nil
+	}
+
+	v6Lease, err := sm.acquireLeaseFor6(path.Join(sm.prefix, "subnets-v6"), sm.cfg.IPv6Network, sm.cfg.IPv6SubnetLen, attrs, stop)
+	if err != nil {
+		log.Errorf("Failed to acquire IPv6 lease, continuing IPv4-only: %s", err)
+		return v4Lease, nil, nil
+	}
+	sm.myLeaseV6 = *v6Lease
+
+	return v4Lease, v6Lease, nil
+}
+
+func (sm *SubnetManager) acquireLeaseFor(subnetsPath string, network ip.IP4Net, subnetLen uint, attrs *LeaseAttrs, stop chan bool) (*Lease, error) {
+	attrBytes, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < registerRetries; i++ {
+		sn := allocateSubnet(network, subnetLen, i)
+		key := path.Join(subnetsPath, encodeSubnetKey(sn.String()))
+
+		err := timeRequest(func() error {
+			_, err := sm.registry.Create(key, string(attrBytes), uint64(subnetTTL.Seconds()))
+			return err
+		})
+		if err != nil {
+			continue
+		}
+
+		l := &Lease{Subnet: sn, Attrs: *attrs, Expiration: time.Now().Add(subnetTTL)}
+		metrics.LeaseExpirySeconds.Set(float64(l.Expiration.Unix()))
+		go sm.renewLoop(key, attrBytes, l, stop)
+		return l, nil
+	}
+
+	return nil, fmt.Errorf("failed to acquire IPv4 subnet lease after %d attempts", registerRetries)
+}
+
+func (sm *SubnetManager) acquireLeaseFor6(subnetsPath string, network ip.IP6Net, subnetLen uint, attrs *LeaseAttrs, stop chan bool) (*Lease, error) {
+	attrBytes, err := json.Marshal(attrs)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := 0; i < registerRetries; i++ {
+		sn := allocateSubnet6(network, subnetLen, i)
+		key := path.Join(subnetsPath, encodeSubnetKey(sn.String()))
+
+		err := timeRequest(func() error {
+			_, err := sm.registry.Create(key, string(attrBytes), uint64(subnetTTL.Seconds()))
+			return err
+		})
+		if err != nil {
+			continue
+		}
+
+		l := &Lease{IPv6Subnet: sn, Attrs: *attrs, Expiration: time.Now().Add(subnetTTL)}
+		go sm.renewLoop(key, attrBytes, l, stop)
+		return l, nil
+	}
+
+	return nil, fmt.Errorf("failed to acquire IPv6 subnet lease after %d attempts", registerRetries)
+}
+
+func (sm *SubnetManager) renewLoop(key string, attrBytes []byte, l *Lease, stop chan bool) {
+	dur := subnetTTL - renewMargin
+
+	for {
+		select {
+		case <-time.After(dur):
+			err := timeRequest(func() error {
+				_, err := sm.registry.Update(key, string(attrBytes), uint64(subnetTTL.Seconds()))
+				return err
+			})
+			if err != nil {
+				log.Errorf("Failed to renew lease for %s: %s", key, err)
+				dur = time.Minute
+				continue
+			}
+			l.Expiration = time.Now().Add(subnetTTL)
+			if !l.Subnet.Empty() {
+				metrics.LeaseExpirySeconds.Set(float64(l.Expiration.Unix()))
+			}
+			dur = subnetTTL - renewMargin
+
+		case <-stop:
+			sm.registry.Delete(key, false)
+			return
+		}
+	}
+}
+
+// WatchLeases streams Add/Remove events for every other host's lease(s),
+// both IPv4 and (when enabled) IPv6, onto receiver until stop is closed.
+func (sm *SubnetManager) WatchLeases(receiver chan Event, stop chan bool) {
+	go sm.watch(path.Join(sm.prefix, "subnets"), false, receiver, stop)
+	if sm.cfg.EnableIPv6 {
+		go sm.watch(path.Join(sm.prefix, "subnets-v6"), true, receiver, stop)
+	}
+}
+
+func (sm *SubnetManager) watch(p string, isV6 bool, receiver chan Event, stop chan bool) {
+	watchChan := make(chan *etcd.Response)
+	go sm.registry.Watch(p, 0, true, watchChan, stop)
+	sm.markPoll()
+
+	for resp := range watchChan {
+		sm.markPoll()
+
+		var l Lease
+		// delete and expire responses carry no value
+		if resp.Node.Value != "" {
+			if err := json.Unmarshal([]byte(resp.Node.Value), &l.Attrs); err != nil {
+				log.Errorf("Error decoding lease attrs at %s: %s", resp.Node.Key, err)
+				continue
+			}
+		}
+
+		ipStr, prefixLen, err := decodeSubnetKey(resp.Node.Key)
+		if err != nil {
+			log.Errorf("Error decoding subnet from key %s: %s", resp.Node.Key, err)
+			continue
+		}
+		if isV6 {
+			l.IPv6Subnet = ip.IP6Net{IP: ip.ParseIP6(ipStr), PrefixLen: prefixLen}
+		} else {
+			l.Subnet = ip.IP4Net{IP: ip.ParseIP4(ipStr), PrefixLen: prefixLen}
+		}
+
+		if (!isV6 && l.Subnet == sm.myLease.Subnet) || (isV6 && l.IPv6Subnet == sm.myLeaseV6.IPv6Subnet) {
+			continue
+		}
+
+		evt := Event{Lease: l}
+		switch resp.Action {
+		case "expire":
+			evt.Type = EventRemoved
+			metrics.WatchEventsTotal.WithLabelValues("expired").Inc()
+		case "delete":
+			evt.Type = EventRemoved
+			metrics.WatchEventsTotal.WithLabelValues("removed").Inc()
+		default:
+			evt.Type = EventAdded
+			metrics.WatchEventsTotal.WithLabelValues("added").Inc()
+		}
+
+		receiver <- evt
+	}
+}
+
+// encodeSubnetKey turns a CIDR string like "10.1.2.0/24" into an etcd key
+// segment, since "/" would otherwise be read as a path separator. The
+// inverse of decodeSubnetKey.
+func encodeSubnetKey(cidr string) string {
+	return strings.Replace(cidr, "/", "-", 1)
+}
+
+// decodeSubnetKey recovers the IP and prefix length encoded by
+// encodeSubnetKey from a full etcd key such as
+// "/coreos.com/network/subnets/10.1.2.0-24".
+func decodeSubnetKey(key string) (ipStr string, prefixLen uint, err error) {
+	base := path.Base(key)
+	i := strings.LastIndex(base, "-")
+	if i < 0 {
+		return "", 0, fmt.Errorf("malformed subnet key %q", key)
+	}
+
+	n, err := strconv.ParseUint(base[i+1:], 10, 32)
+	if err != nil {
+		return "", 0, fmt.Errorf("malformed subnet key %q: %s", key, err)
+	}
+
+	return base[:i], uint(n), nil
+}
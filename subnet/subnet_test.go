@@ -0,0 +1,34 @@
+package subnet
+
+import "testing"
+
+func TestSubnetKeyRoundTrip(t *testing.T) {
+	tests := []struct {
+		cidr      string
+		prefixLen uint
+	}{
+		{"10.1.2.0/24", 24},
+		{"fd00:100::/56", 56},
+	}
+
+	for _, tt := range tests {
+		key := "/coreos.com/network/subnets/" + encodeSubnetKey(tt.cidr)
+
+		ipStr, prefixLen, err := decodeSubnetKey(key)
+		if err != nil {
+			t.Fatalf("decodeSubnetKey(%q): %s", key, err)
+		}
+		if prefixLen != tt.prefixLen {
+			t.Errorf("decodeSubnetKey(%q) prefixLen = %d, want %d", key, prefixLen, tt.prefixLen)
+		}
+		if want := tt.cidr[:len(tt.cidr)-len("/24")]; ipStr != want {
+			t.Errorf("decodeSubnetKey(%q) ip = %q, want %q", key, ipStr, want)
+		}
+	}
+}
+
+func TestDecodeSubnetKeyMalformed(t *testing.T) {
+	if _, _, err := decodeSubnetKey("/coreos.com/network/subnets/not-a-subnet-key-at-all-nope"); err == nil {
+		t.Error("decodeSubnetKey with no numeric prefix length should have failed")
+	}
+}